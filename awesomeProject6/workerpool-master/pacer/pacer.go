@@ -11,7 +11,21 @@ will be paced in both cases.
 */
 package pacer
 
-import "time"
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ErrPacerStopped is returned by NextCtx (and surfaced through PaceCtx) when
+// the Pacer was stopped while the caller was waiting for its turn.
+var ErrPacerStopped = errors.New("pacer: stopped")
+
+// maxBurstCapacity bounds the internal token channel of a burst Pacer so that
+// SetBurst can raise the burst size later without recreating the channel.
+const maxBurstCapacity = 1 << 20
 
 // Pacer is a goroutine rate limiter.  When concurrent goroutines call
 // Pacer.Next(), the call returns in a single goroutine at a time, at a rate no
@@ -42,6 +56,16 @@ type Pacer struct {  //先定义结构体.
 	gate   chan struct{}
 	pause  chan struct{}
 	paused chan struct{}
+	done   chan struct{} // closed by Stop to wake blocked NextCtx callers
+	stop   sync.Once
+
+	// tokens is non-nil for a burst Pacer created by NewBurstPacer, in which
+	// case it replaces gate/run's one-per-delay ticking with a refilled
+	// token bucket. rate and burst back SetRate/SetBurst and are read
+	// atomically by the refill loop.
+	tokens chan struct{}
+	rate   int64 // atomic, nanoseconds
+	burst  int32 // atomic
 }
 
 // NewPacer creates and runs a new Pacer.
@@ -51,12 +75,39 @@ func NewPacer(delay time.Duration) *Pacer {
 		gate:   make(chan struct{}),
 		pause:  make(chan struct{}, 1),
 		paused: make(chan struct{}, 1),
+		done:   make(chan struct{}),
 	}
 
 	go p.run()
 	return p
 }
 
+// NewBurstPacer creates and runs a new Pacer backed by a token bucket: the
+// bucket starts full with burst tokens, then one more accumulates per rate
+// as tokens are spent. Next consumes a token, blocking only once the bucket
+// is empty. This lets callers absorb an initial burst, then further short
+// bursts followed by idle periods, instead of being held to exactly one
+// task per rate like NewPacer. Pace, Pause, Resume and IsPaused all work the
+// same as on a regular Pacer.
+func NewBurstPacer(rate time.Duration, burst int) *Pacer {
+	p := &Pacer{
+		delay:  rate,
+		gate:   make(chan struct{}),
+		pause:  make(chan struct{}, 1),
+		paused: make(chan struct{}, 1),
+		done:   make(chan struct{}),
+		tokens: make(chan struct{}, maxBurstCapacity),
+	}
+	atomic.StoreInt64(&p.rate, int64(rate))
+	atomic.StoreInt32(&p.burst, int32(burst))
+	for i := 0; i < burst; i++ {
+		p.tokens <- struct{}{}
+	}
+
+	go p.refill()
+	return p
+}
+
 // Pace wraps a function in a paced function.  The returned paced function can
 // then be submitted to the workerpool, using Submit or SubmitWait, and
 // starting the tasks is paced according to the pacer's delay.
@@ -67,8 +118,18 @@ func (p *Pacer) Pace(task func()) func() { // 放入一个函数.返回一个新
 	}
 }
 
-
-
+// PaceCtx wraps a function in a paced function, same as Pace, except the
+// returned function takes a context and aborts, without running task, if the
+// context is cancelled or the Pacer is stopped before the task's turn comes
+// up.
+func (p *Pacer) PaceCtx(task func(context.Context) error) func(context.Context) error {
+	return func(ctx context.Context) error {
+		if err := p.NextCtx(ctx); err != nil {
+			return err
+		}
+		return task(ctx)
+	}
+}
 
 
 
@@ -77,15 +138,88 @@ func (p *Pacer) Pace(task func()) func() { // 放入一个函数.返回一个新
 
 
 // Next submits a run request to the gate and returns when it is time to run.
+// On a burst Pacer, it instead waits for a token to be available.
 func (p *Pacer) Next() {
+	if p.tokens != nil {
+		<-p.tokens
+		return
+	}
 	// Wait for item to be read from gate.
 	p.gate <- struct{}{}
 }
 
+// NextCtx is like Next, but also returns early with ctx.Err() if ctx is
+// cancelled, or ErrPacerStopped if the Pacer is stopped, before the turn to
+// run comes up.
+func (p *Pacer) NextCtx(ctx context.Context) error {
+	if p.tokens != nil {
+		select {
+		case <-p.tokens:
+			return nil
+		case <-p.done:
+			return ErrPacerStopped
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	select {
+	case p.gate <- struct{}{}:
+		return nil
+	case <-p.done:
+		return ErrPacerStopped
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// TryNext makes a non-blocking attempt to take the next run slot, and
+// reports whether it succeeded.
+func (p *Pacer) TryNext() bool {
+	if p.tokens != nil {
+		select {
+		case <-p.tokens:
+			return true
+		default:
+			return false
+		}
+	}
+	select {
+	case p.gate <- struct{}{}:
+		return true
+	default:
+		return false
+	}
+}
+
+// Tokens returns the number of tokens currently available in a burst
+// Pacer's bucket. It is always 0 for a Pacer created by NewPacer.
+func (p *Pacer) Tokens() int {
+	return len(p.tokens)
+}
+
+// SetRate changes how often a burst Pacer refills its bucket with one more
+// token, effective on the refill loop's next tick. It has no effect on a
+// Pacer created by NewPacer.
+func (p *Pacer) SetRate(rate time.Duration) {
+	atomic.StoreInt64(&p.rate, int64(rate))
+}
+
+// SetBurst changes the maximum number of tokens a burst Pacer accumulates.
+// Lowering it does not discard tokens already in the bucket; the bucket
+// simply stops refilling until consumption brings it back under the new
+// burst size. It has no effect on a Pacer created by NewPacer.
+func (p *Pacer) SetBurst(burst int) {
+	atomic.StoreInt32(&p.burst, int32(burst))
+}
+
 // Stop stops the Pacer from running.  Do not call until all paced tasks have
-// completed, or paced tasks will hang waiting for pacer to unblock them.
+// completed, or paced tasks will hang waiting for pacer to unblock them. It
+// is safe to call Stop more than once; only the first call has an effect,
+// and any goroutine blocked in NextCtx is woken with ErrPacerStopped.
 func (p *Pacer) Stop() {  //关闭所有任务.
-	close(p.gate)
+	p.stop.Do(func() {
+		close(p.done)
+	})
 }
 
 // IsPaused returns true if execution is paused.
@@ -108,12 +242,41 @@ func (p *Pacer) Resume() {
 func (p *Pacer) run() {
 	// Read item from gate no faster than one per delay.
 	// Reading from the unbuffered channel serves as a "tick"
-	// and unblocks the writer.
-	for _ = range p.gate {  // 用range来遍历一个channel
-		time.Sleep(p.delay)
-		p.pause <- struct{}{} // will wait here if channel blocked  这两行用于阻塞这个for循环.
-								//阻塞会阻塞掉当前代码所在的go语句的上下文.所以就实现了,在gate中每跑一个等待一段时间.
+	// and unblocks the writer. Also watch done so Stop can retire this
+	// goroutine without closing gate (which would panic pending Next sends).
+	for {
+		select {
+		case <-p.gate: // 用select来代替for range,这样done关闭时才能退出,而不用关gate.
+			time.Sleep(p.delay)
+			p.pause <- struct{}{} // will wait here if channel blocked  这两行用于阻塞这个for循环.
+									//阻塞会阻塞掉当前代码所在的go语句的上下文.所以就实现了,在gate中每跑一个等待一段时间.
+			<-p.pause             // clear channel
+		case <-p.done:
+			return
+		}
+	}
+}
+
+// refill adds one token per rate to a burst Pacer's bucket, up to burst
+// tokens, until Stop closes done. Pause/Resume gate it the same way they
+// gate run: the refiller stops adding tokens while paused, but tokens
+// already in the bucket are kept and can still be consumed by Next.
+func (p *Pacer) refill() {
+	for {
+		select {
+		case <-time.After(time.Duration(atomic.LoadInt64(&p.rate))):
+		case <-p.done:
+			return
+		}
+		p.pause <- struct{}{} // will wait here if channel blocked
 		<-p.pause             // clear channel
+
+		if int32(len(p.tokens)) < atomic.LoadInt32(&p.burst) {
+			select {
+			case p.tokens <- struct{}{}:
+			default: // channel already holds maxBurstCapacity tokens; drop this one
+			}
+		}
 	}
 }
 
@@ -124,3 +287,144 @@ func (p *Pacer) run() {
 //链接：https://www.jianshu.com/p/24ede9e90490
 //来源：简书
 //著作权归作者所有。商业转载请联系作者获得授权，非商业转载请注明出处。
+
+// Outcome reports the result of a task run through an AdaptivePacer, so the
+// pacer can decide whether to speed up or back off.
+type Outcome int
+
+const (
+	// OK means the task succeeded and the downstream kept up.
+	OK Outcome = iota
+	// Slow means the task succeeded but the downstream looked strained.
+	Slow
+	// Reject means the downstream refused or failed the task.
+	Reject
+)
+
+// AdaptivePacer is a goroutine rate limiter whose interval reacts to
+// downstream feedback reported through Report, using an AIMD control law:
+// OK additively decreases the interval toward floor; Slow and Reject
+// multiplicatively increase it toward ceiling. Unlike Pacer, it has no
+// fixed delay; call NewAdaptivePacer with the interval bounds and step
+// parameters, then use PaceWithReport so each task's outcome feeds back
+// into the controller automatically.
+type AdaptivePacer struct {
+	interval int64 // atomic, nanoseconds; current pacing interval
+	floor    time.Duration
+	ceiling  time.Duration
+	step     time.Duration
+	factor   float64
+
+	gate   chan struct{}
+	pause  chan struct{}
+	paused chan struct{}
+	done   chan struct{}
+	stop   sync.Once
+}
+
+// NewAdaptivePacer creates and runs a new AdaptivePacer starting at base,
+// constrained to [floor, ceiling]. Report(OK) steps the interval down by
+// step; Report(Slow) or Report(Reject) multiplies it by factor.
+func NewAdaptivePacer(base, floor, ceiling, step time.Duration, factor float64) *AdaptivePacer {
+	p := &AdaptivePacer{
+		floor:   floor,
+		ceiling: ceiling,
+		step:    step,
+		factor:  factor,
+		gate:    make(chan struct{}),
+		pause:   make(chan struct{}, 1),
+		paused:  make(chan struct{}, 1),
+		done:    make(chan struct{}),
+	}
+	atomic.StoreInt64(&p.interval, int64(base))
+
+	go p.run()
+	return p
+}
+
+// PaceWithReport wraps a function in a paced function, the same way
+// Pacer.Pace does, except task reports back an Outcome that PaceWithReport
+// forwards to Report once task returns, so the pacer adapts automatically.
+func (p *AdaptivePacer) PaceWithReport(task func() Outcome) func() {
+	return func() {
+		p.Next()
+		p.Report(task())
+	}
+}
+
+// Next submits a run request to the gate and returns when it is time to run.
+func (p *AdaptivePacer) Next() {
+	p.gate <- struct{}{}
+}
+
+// Report feeds a task's outcome back into the controller, adjusting the
+// current interval per the AIMD rule. It is safe to call concurrently with
+// Next and does not block.
+func (p *AdaptivePacer) Report(outcome Outcome) {
+	for {
+		current := atomic.LoadInt64(&p.interval)
+		var next int64
+		if outcome == OK {
+			next = current - int64(p.step)
+			if next < int64(p.floor) {
+				next = int64(p.floor)
+			}
+		} else {
+			next = int64(float64(current) * p.factor)
+			if next > int64(p.ceiling) {
+				next = int64(p.ceiling)
+			}
+		}
+		if atomic.CompareAndSwapInt64(&p.interval, current, next) {
+			return
+		}
+	}
+}
+
+// CurrentInterval returns the interval the pacer is currently sleeping for
+// between tasks.
+func (p *AdaptivePacer) CurrentInterval() time.Duration {
+	return time.Duration(atomic.LoadInt64(&p.interval))
+}
+
+// Stop stops the AdaptivePacer from running.  Do not call until all paced
+// tasks have completed, or paced tasks will hang waiting for pacer to
+// unblock them. It is safe to call Stop more than once.
+func (p *AdaptivePacer) Stop() {
+	p.stop.Do(func() {
+		close(p.done)
+	})
+}
+
+// IsPaused returns true if execution is paused.
+func (p *AdaptivePacer) IsPaused() bool {
+	return len(p.paused) != 0
+}
+
+// Pause suspends execution of any tasks by the pacer.
+func (p *AdaptivePacer) Pause() {
+	p.pause <- struct{}{}  // block this channel
+	p.paused <- struct{}{} // set flag to indicate paused
+}
+
+// Resume continues execution after Pause.
+func (p *AdaptivePacer) Resume() {
+	<-p.paused // clear flag to indicate paused
+	<-p.pause  // unblock this channel
+}
+
+func (p *AdaptivePacer) run() {
+	// Read item from gate no faster than one per current interval, the same
+	// gating pattern Pacer.run uses, except the sleep duration is read fresh
+	// from interval (set by Report) on every tick instead of being fixed.
+	for {
+		select {
+		case <-p.gate:
+			time.Sleep(time.Duration(atomic.LoadInt64(&p.interval)))
+			p.pause <- struct{}{} // will wait here if channel blocked
+			<-p.pause             // clear channel
+		case <-p.done:
+			return
+		}
+	}
+}
@@ -0,0 +1,113 @@
+/*
+Copyright 2017 Caicloud Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package executor defines the executor a matched route runs, and the
+// middleware wrapper type the router package composes around it. This
+// fragment only carries the pieces router's method_host.go and group.go
+// depend on, not the full upstream package.
+package executor
+
+import (
+	"context"
+	"strings"
+)
+
+// MiddlewareExecutor is what a Router's Match returns: the thing a matched
+// route knows how to run for the inbound request.
+type MiddlewareExecutor interface {
+	// Execute runs the executor for ctx.
+	Execute(ctx context.Context) error
+}
+
+// Chain represents the remainder of a middleware chain. Continue runs
+// whatever comes after the current middleware, ending with the wrapped
+// MiddlewareExecutor itself.
+type Chain interface {
+	Continue(ctx context.Context) error
+}
+
+// Middleware wraps a MiddlewareExecutor's execution. It calls
+// chain.Continue to proceed to the next middleware (or the wrapped
+// executor), or returns its own error to stop the chain short.
+type Middleware func(ctx context.Context, chain Chain) error
+
+// WrapMiddleware composes middlewares around e: the first middleware runs
+// first, and each Chain.Continue call advances to the next, ending with e
+// itself. With no middlewares, it returns e unchanged.
+func WrapMiddleware(e MiddlewareExecutor, middlewares ...Middleware) MiddlewareExecutor {
+	if len(middlewares) == 0 {
+		return e
+	}
+	return &middlewareChain{executor: e, middlewares: middlewares}
+}
+
+// middlewareChain implements both MiddlewareExecutor and Chain: Execute
+// starts the first middleware, and each Continue call advances to the
+// next middleware, or to the wrapped executor once middlewares run out.
+type middlewareChain struct {
+	executor    MiddlewareExecutor
+	middlewares []Middleware
+}
+
+// MethodNotAllowed returns an executor that fails every request with a 405
+// Method Not Allowed, reporting allowed as the set of methods the route
+// does accept, so a caller can surface it as the response's Allow header.
+func MethodNotAllowed(allowed []string) MiddlewareExecutor {
+	return &methodNotAllowedExecutor{allowed: allowed}
+}
+
+// methodNotAllowedExecutor is the executor methodNode.Match falls back to
+// when the request's method isn't one of the methods registered for the
+// path.
+type methodNotAllowedExecutor struct {
+	allowed []string
+}
+
+// Execute always fails with a 405, listing the methods that are allowed.
+func (e *methodNotAllowedExecutor) Execute(ctx context.Context) error {
+	return methodNotAllowedError{allowed: e.allowed}
+}
+
+// methodNotAllowedError is the error a methodNotAllowedExecutor's Execute
+// returns; service-layer code can type-assert it to set the Allow header.
+type methodNotAllowedError struct {
+	allowed []string
+}
+
+// Error implements error.
+func (e methodNotAllowedError) Error() string {
+	return "method not allowed, allowed methods: " + strings.Join(e.allowed, ", ")
+}
+
+// Allowed returns the methods the route accepts.
+func (e methodNotAllowedError) Allowed() []string {
+	return e.allowed
+}
+
+// Execute runs the chain from its first middleware.
+func (c *middlewareChain) Execute(ctx context.Context) error {
+	return c.Continue(ctx)
+}
+
+// Continue runs the next middleware in the chain, or the wrapped executor
+// once middlewares is exhausted.
+func (c *middlewareChain) Continue(ctx context.Context) error {
+	if len(c.middlewares) == 0 {
+		return c.executor.Execute(ctx)
+	}
+	next := &middlewareChain{executor: c.executor, middlewares: c.middlewares[1:]}
+	return c.middlewares[0](ctx, next)
+}
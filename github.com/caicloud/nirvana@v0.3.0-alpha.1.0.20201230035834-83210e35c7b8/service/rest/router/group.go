@@ -0,0 +1,117 @@
+/*
+Copyright 2017 Caicloud Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package router
+
+import (
+	"context"
+	"reflect"
+
+	"github.com/caicloud/nirvana/service/executor"
+)
+
+// Group represents a set of routes sharing a path prefix and a middleware
+// chain, Gin style:
+//
+//     g := router.NewGroup("/api/v1").Use(mwA, mwB)
+//     users := g.Subgroup("/users").Use(mwC)
+//
+// Groups nest: a Subgroup's effective chain is its parent's chain followed
+// by its own, in registration order.
+type Group struct {
+	prefix      string
+	parent      *Group
+	middlewares []executor.Middleware
+}
+
+// NewGroup creates a root Group scoped to prefix.
+func NewGroup(prefix string) *Group {
+	return &Group{prefix: prefix}
+}
+
+// Use appends middlewares to the group's chain and returns the group, so
+// calls can be chained at the call site.
+func (g *Group) Use(middlewares ...executor.Middleware) *Group {
+	g.middlewares = append(g.middlewares, middlewares...)
+	return g
+}
+
+// Subgroup creates a nested Group scoped to g's prefix plus prefix,
+// inheriting g's middleware chain ahead of whatever the nested group adds
+// with its own Use.
+func (g *Group) Subgroup(prefix string) *Group {
+	return &Group{prefix: g.prefix + prefix, parent: g}
+}
+
+// Prefix returns the group's full, accumulated path prefix.
+func (g *Group) Prefix() string {
+	return g.prefix
+}
+
+// Chain returns the group's effective middleware chain: every ancestor's
+// middlewares, outermost ancestor first, followed by the group's own.
+func (g *Group) Chain() []executor.Middleware {
+	var chain []executor.Middleware
+	if g.parent != nil {
+		chain = append(chain, g.parent.Chain()...)
+	}
+	return append(chain, g.middlewares...)
+}
+
+// Compile wraps tree so that every executor tree's Match produces runs
+// behind g's effective chain, in the same ancestor-first order Chain
+// returns. This is equivalent to folding the chain into the handler.pack
+// step of every node in tree, without Compile needing to know tree's
+// concrete node types.
+func (g *Group) Compile(tree Router) Router {
+	chain := g.Chain()
+	if len(chain) == 0 {
+		return tree
+	}
+	return &groupRouter{Router: tree, middlewares: chain}
+}
+
+// groupRouter wraps a Router so that every executor it returns from Match
+// runs behind middlewares.
+type groupRouter struct {
+	Router
+	middlewares []executor.Middleware
+}
+
+// Match find an executor matched by path, with the group's middleware
+// chain already applied.
+func (n *groupRouter) Match(ctx context.Context, c Container, path string) (executor.MiddlewareExecutor, error) {
+	e, err := n.Router.Match(ctx, c, path)
+	if err != nil {
+		return nil, err
+	}
+	return executor.WrapMiddleware(e, n.middlewares...), nil
+}
+
+// Merge merges r to the current router. The type of r should be same
+// as the current one or it returns an error.
+func (n *groupRouter) Merge(r Router) (Router, error) {
+	node, ok := r.(*groupRouter)
+	if !ok {
+		return nil, unknownRouterType.Error(r.Kind(), reflect.TypeOf(r).String())
+	}
+	merged, err := n.Router.Merge(node.Router)
+	if err != nil {
+		return nil, err
+	}
+	n.Router = merged
+	return n, nil
+}
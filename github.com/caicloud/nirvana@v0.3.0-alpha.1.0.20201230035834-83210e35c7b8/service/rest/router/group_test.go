@@ -0,0 +1,191 @@
+/*
+Copyright 2017 Caicloud Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package router
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/caicloud/nirvana/service/executor"
+)
+
+// fakeRouter is a minimal Router used to exercise Group/groupRouter without
+// depending on the concrete path-node types built elsewhere in this
+// package. Match and Merge append what they did to trace so tests can assert
+// on it; Match returns a recordingExecutor that does the same when run.
+type fakeRouter struct {
+	name  string
+	trace *[]string
+}
+
+func (f *fakeRouter) Target() string  { return f.name }
+func (f *fakeRouter) Kind() RouteKind { return Regexp }
+
+func (f *fakeRouter) Match(ctx context.Context, c Container, path string) (executor.MiddlewareExecutor, error) {
+	*f.trace = append(*f.trace, "match:"+f.name)
+	return &recordingExecutor{trace: f.trace, label: "exec:" + f.name}, nil
+}
+
+// recordingExecutor is a minimal MiddlewareExecutor that appends label to
+// trace when run, so tests can assert it ran (and where, relative to
+// middlewares) without depending on executor values being comparable.
+type recordingExecutor struct {
+	trace *[]string
+	label string
+}
+
+func (e *recordingExecutor) Execute(ctx context.Context) error {
+	*e.trace = append(*e.trace, e.label)
+	return nil
+}
+
+func (f *fakeRouter) Merge(r Router) (Router, error) {
+	other, ok := r.(*fakeRouter)
+	if !ok {
+		return nil, unknownRouterType.Error(r.Kind(), reflect.TypeOf(r).String())
+	}
+	*f.trace = append(*f.trace, "merge:"+f.name+"+"+other.name)
+	return f, nil
+}
+
+// recordingMiddleware returns an executor.Middleware that appends label to
+// trace when run, so tests can assert on invocation order without depending
+// on middleware values being comparable. When driven directly (as in
+// TestGroupSubgroupChainAncestorOrder) chain is nil and there's nothing to
+// continue to; when driven through groupRouter.Match, chain is the rest of
+// the chain (or the wrapped executor) and must be continued.
+func recordingMiddleware(trace *[]string, label string) executor.Middleware {
+	return func(ctx context.Context, chain executor.Chain) error {
+		*trace = append(*trace, label)
+		if chain == nil {
+			return nil
+		}
+		return chain.Continue(ctx)
+	}
+}
+
+func TestGroupSubgroupChainAncestorOrder(t *testing.T) {
+	var trace []string
+	root := NewGroup("/api").Use(
+		recordingMiddleware(&trace, "root-a"),
+		recordingMiddleware(&trace, "root-b"),
+	)
+	users := root.Subgroup("/users").Use(recordingMiddleware(&trace, "users-a"))
+
+	if got, want := users.Prefix(), "/api/users"; got != want {
+		t.Fatalf("Prefix() = %q, want %q", got, want)
+	}
+
+	chain := users.Chain()
+	if len(chain) != 3 {
+		t.Fatalf("len(Chain()) = %d, want 3", len(chain))
+	}
+	for _, mw := range chain {
+		if err := mw(context.Background(), nil); err != nil {
+			t.Fatalf("middleware returned error: %v", err)
+		}
+	}
+	if want := []string{"root-a", "root-b", "users-a"}; !reflect.DeepEqual(trace, want) {
+		t.Fatalf("invocation order = %v, want %v", trace, want)
+	}
+
+	// A grandchild subgroup keeps composing ancestor-first.
+	admins := users.Subgroup("/admins").Use(recordingMiddleware(&trace, "admins-a"))
+	if got, want := admins.Prefix(), "/api/users/admins"; got != want {
+		t.Fatalf("Prefix() = %q, want %q", got, want)
+	}
+	trace = nil
+	for _, mw := range admins.Chain() {
+		if err := mw(context.Background(), nil); err != nil {
+			t.Fatalf("middleware returned error: %v", err)
+		}
+	}
+	if want := []string{"root-a", "root-b", "users-a", "admins-a"}; !reflect.DeepEqual(trace, want) {
+		t.Fatalf("nested invocation order = %v, want %v", trace, want)
+	}
+}
+
+func TestGroupRouterMatchWrapsInAncestorOrder(t *testing.T) {
+	var trace []string
+	root := NewGroup("/api").Use(recordingMiddleware(&trace, "root-a"))
+	users := root.Subgroup("/users").Use(recordingMiddleware(&trace, "users-a"))
+
+	tree := users.Compile(&fakeRouter{name: "users", trace: &trace})
+
+	e, err := tree.Match(context.Background(), nil, "/users")
+	if err != nil {
+		t.Fatalf("Match() error = %v", err)
+	}
+	if err := e.Execute(context.Background()); err != nil {
+		t.Fatalf("Execute() error = %v", err)
+	}
+
+	// match:users is recorded by fakeRouter.Match itself, before the
+	// returned executor is ever wrapped or run; the middlewares and the
+	// wrapped executor only run on Execute, ancestor-first.
+	want := []string{"match:users", "root-a", "users-a", "exec:users"}
+	if !reflect.DeepEqual(trace, want) {
+		t.Fatalf("execution order = %v, want %v", trace, want)
+	}
+}
+
+func TestGroupRouterMergeOverlapping(t *testing.T) {
+	var trace []string
+	g := NewGroup("/api").Use(recordingMiddleware(&trace, "auth"))
+
+	left := g.Compile(&fakeRouter{name: "left", trace: &trace})
+	right := g.Compile(&fakeRouter{name: "right", trace: &trace})
+
+	merged, err := left.Merge(right)
+	if err != nil {
+		t.Fatalf("Merge() error = %v", err)
+	}
+
+	gr, ok := merged.(*groupRouter)
+	if !ok {
+		t.Fatalf("Merge() returned %T, want *groupRouter", merged)
+	}
+	if len(gr.middlewares) != 1 {
+		t.Fatalf("len(middlewares) = %d, want 1 (the shared group chain, not duplicated)", len(gr.middlewares))
+	}
+
+	fr, ok := gr.Router.(*fakeRouter)
+	if !ok {
+		t.Fatalf("gr.Router = %T, want *fakeRouter", gr.Router)
+	}
+	if fr.name != "left" {
+		t.Fatalf("gr.Router.name = %q, want %q (left's tree absorbs right)", fr.name, "left")
+	}
+	if want := "merge:left+right"; len(trace) == 0 || trace[len(trace)-1] != want {
+		t.Fatalf("trace = %v, want last entry %q", trace, want)
+	}
+}
+
+func TestGroupRouterMergeRejectsUnknownType(t *testing.T) {
+	var trace []string
+	g := NewGroup("/api")
+	left := g.Compile(&fakeRouter{name: "left", trace: &trace})
+	if _, ok := left.(*groupRouter); ok {
+		t.Fatalf("Compile with no middleware should return the tree unwrapped")
+	}
+
+	wrapped := NewGroup("/api").Use(recordingMiddleware(&trace, "auth")).Compile(&fakeRouter{name: "left", trace: &trace})
+	if _, err := wrapped.Merge(&fakeRouter{name: "other", trace: &trace}); err == nil {
+		t.Fatal("Merge() with a non-*groupRouter should error")
+	}
+}
@@ -0,0 +1,318 @@
+/*
+Copyright 2017 Caicloud Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package router
+
+import (
+	"context"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/caicloud/nirvana/service/executor"
+)
+
+// requestContextKey is the type of context keys used to carry request
+// metadata (method, host) that method/host nodes need to dispatch Match,
+// mirroring how path variables are carried out-of-band via Container.
+type requestContextKey int
+
+const (
+	methodContextKey requestContextKey = iota
+	hostContextKey
+)
+
+// Method and Host extend this package's RouteKind enumeration with the two
+// kinds methodNode and hostNode report from Kind(). They start well above
+// the kinds path nodes already use (Regexp and friends) so they can't
+// collide with those.
+const (
+	Method RouteKind = 100 + iota
+	Host
+)
+
+// ContextWithMethod returns a copy of ctx carrying method, for use by the
+// service layer before it calls into the router tree.
+func ContextWithMethod(ctx context.Context, method string) context.Context {
+	return context.WithValue(ctx, methodContextKey, method)
+}
+
+// MethodFrom extracts the HTTP method carried by ctx, as set by
+// ContextWithMethod.
+func MethodFrom(ctx context.Context) string {
+	method, _ := ctx.Value(methodContextKey).(string)
+	return method
+}
+
+// ContextWithHost returns a copy of ctx carrying host, for use by the
+// service layer before it calls into the router tree.
+func ContextWithHost(ctx context.Context, host string) context.Context {
+	return context.WithValue(ctx, hostContextKey, host)
+}
+
+// HostFrom extracts the Host header value carried by ctx, as set by
+// ContextWithHost.
+func HostFrom(ctx context.Context) string {
+	host, _ := ctx.Value(hostContextKey).(string)
+	return host
+}
+
+// NewMethodRoute scopes tree to method: the returned Router only dispatches
+// to tree when the request's method (carried via ContextWithMethod) matches,
+// falling back to a 405 otherwise. Registering the same path for several
+// methods is a matter of merging their NewMethodRoute trees, the same way
+// the path parser merges any other two trees that share a prefix.
+func NewMethodRoute(method string, tree Router) Router {
+	n := newMethodNode()
+	n.methods[strings.ToUpper(method)] = tree
+	return n
+}
+
+// NewHostRoute scopes tree to host, an exact host such as "api.example.com"
+// or a "{sub}.example.com" wildcard pattern. It returns an error if host's
+// wildcard segment is malformed.
+func NewHostRoute(host string, tree Router) (Router, error) {
+	n := newHostNode()
+	if err := n.RegisterHost(host, tree); err != nil {
+		return nil, err
+	}
+	return n, nil
+}
+
+// methodNode dispatches to a child router tree based on the HTTP method
+// carried by ctx. It sits directly above the path tree for a route, so the
+// same path can be registered with different handlers per method.
+type methodNode struct {
+	// methods maps an HTTP method, e.g. "GET", to the router tree that
+	// handles requests using that method.
+	methods map[string]Router
+}
+
+// newMethodNode creates an empty methodNode.
+func newMethodNode() *methodNode {
+	return &methodNode{methods: make(map[string]Router)}
+}
+
+// Target returns the matching target of the node.
+func (n *methodNode) Target() string {
+	return "{method}"
+}
+
+// Kind returns the kind of the router node.
+func (n *methodNode) Kind() RouteKind {
+	return Method
+}
+
+// Match finds an executor matched by path for the request method carried by
+// ctx. If no route was registered for that method, it falls back to a 405
+// Method Not Allowed executor enumerating the methods registered here,
+// rather than an error, so the Allow set reaches the HTTP response.
+func (n *methodNode) Match(ctx context.Context, c Container, path string) (executor.MiddlewareExecutor, error) {
+	if r, ok := n.methods[MethodFrom(ctx)]; ok {
+		return r.Match(ctx, c, path)
+	}
+	return executor.MethodNotAllowed(n.allowed()), nil
+}
+
+// allowed returns the methods registered on this node, sorted for
+// deterministic error messages.
+func (n *methodNode) allowed() []string {
+	methods := make([]string, 0, len(n.methods))
+	for method := range n.methods {
+		methods = append(methods, method)
+	}
+	sort.Strings(methods)
+	return methods
+}
+
+// Merge merges r to the current router. The type of r should be same
+// as the current one or it returns an error.
+func (n *methodNode) Merge(r Router) (Router, error) {
+	node, ok := r.(*methodNode)
+	if !ok {
+		return nil, unknownRouterType.Error(r.Kind(), reflect.TypeOf(r).String())
+	}
+	for method, child := range node.methods {
+		existing, ok := n.methods[method]
+		if !ok {
+			n.methods[method] = child
+			continue
+		}
+		merged, err := existing.Merge(child)
+		if err != nil {
+			return nil, err
+		}
+		n.methods[method] = merged
+	}
+	return n, nil
+}
+
+// hostWildcard is a host pattern such as "{sub}.example.com": a single
+// variable segment followed by a fixed suffix.
+type hostWildcard struct {
+	key    string
+	suffix string
+	router Router
+}
+
+// hostNode dispatches to a child router tree based on the Host header
+// carried by ctx. It sits above methodNode (and the path tree below it), so
+// a route can be scoped to one or more hosts.
+//
+// methodNode and hostNode always sit above the path tree - regexpNode,
+// fullMatchRegexpNode, and friends - scoping a whole subtree to a method or
+// host rather than appearing as a sibling within it. Because of that, none
+// of the existing path-node Merge methods need to change to account for
+// these two: a regexpNode's Merge, for instance, only ever merges with
+// another regexpNode below a methodNode/hostNode, never with one directly.
+type hostNode struct {
+	// hosts maps an exact host to its router tree.
+	hosts map[string]Router
+	// wildcards holds "{sub}.example.com"-style patterns, tried in
+	// registration order after an exact match fails.
+	wildcards []hostWildcard
+}
+
+// newHostNode creates an empty hostNode.
+func newHostNode() *hostNode {
+	return &hostNode{hosts: make(map[string]Router)}
+}
+
+// RegisterHost adds tree under pattern, which is either an exact host such
+// as "api.example.com", or a single leading wildcard segment such as
+// "{sub}.example.com". It returns an error if pattern's wildcard segment is
+// malformed (an unterminated "{").
+func (n *hostNode) RegisterHost(pattern string, tree Router) error {
+	key, suffix, ok, err := parseHostWildcard(pattern)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		n.hosts[pattern] = tree
+		return nil
+	}
+	n.wildcards = append(n.wildcards, hostWildcard{key: key, suffix: suffix, router: tree})
+	return nil
+}
+
+// parseHostWildcard splits a "{name}.rest.of.host"-style pattern into its
+// variable name and the fixed suffix that follows it. ok is false, with no
+// error, when pattern has no leading "{...}" wildcard segment at all.
+func parseHostWildcard(pattern string) (key, suffix string, ok bool, err error) {
+	if !strings.HasPrefix(pattern, "{") {
+		return "", "", false, nil
+	}
+	end := strings.IndexByte(pattern, '}')
+	if end < 0 {
+		return "", "", false, unmatchedRouterKey.Error(pattern, "missing closing '}'")
+	}
+	return pattern[1:end], pattern[end+1:], true, nil
+}
+
+// Target returns the matching target of the node.
+func (n *hostNode) Target() string {
+	return "{host}"
+}
+
+// Kind returns the kind of the router node.
+func (n *hostNode) Kind() RouteKind {
+	return Host
+}
+
+// Match finds an executor matched by path for the Host header carried by
+// ctx. A wildcard host populates Container with its variable, the same way
+// a path variable does.
+//
+// Like regexpNode.Match, this only calls c.Set once a match has fully
+// succeeded; c.Set(w.key, value) is gated behind w.router.Match returning
+// no error. What it can't guarantee is a failed wildcard's subtree itself:
+// w.router.Match may have called c.Set on its own way to failing (e.g. a
+// regexpNode deeper in that subtree matched before a sibling further down
+// didn't), and Container exposes no way to snapshot or roll that back. A
+// caller relying on Container's contents after a Match that ultimately
+// returns routerNotFound should not assume it's untouched.
+func (n *hostNode) Match(ctx context.Context, c Container, path string) (executor.MiddlewareExecutor, error) {
+	host := HostFrom(ctx)
+	if r, ok := n.hosts[host]; ok {
+		return r.Match(ctx, c, path)
+	}
+	for _, w := range n.wildcards {
+		value, ok := matchHostWildcard(host, w.suffix)
+		if !ok {
+			continue
+		}
+		e, err := w.router.Match(ctx, c, path)
+		if err != nil {
+			// This wildcard's host matched but its subtree didn't match
+			// path; keep trying other wildcards instead of failing here.
+			continue
+		}
+		c.Set(w.key, value)
+		return e, nil
+	}
+	return nil, routerNotFound.Error()
+}
+
+// matchHostWildcard checks host against a "{sub}.example.com"-style pattern
+// whose fixed part is suffix, and returns the value that would be bound to
+// the wildcard segment.
+func matchHostWildcard(host, suffix string) (string, bool) {
+	if !strings.HasSuffix(host, suffix) {
+		return "", false
+	}
+	value := host[:len(host)-len(suffix)]
+	if value == "" || strings.Contains(value, ".") {
+		return "", false
+	}
+	return value, true
+}
+
+// Merge merges r to the current router. The type of r should be same
+// as the current one or it returns an error.
+func (n *hostNode) Merge(r Router) (Router, error) {
+	node, ok := r.(*hostNode)
+	if !ok {
+		return nil, unknownRouterType.Error(r.Kind(), reflect.TypeOf(r).String())
+	}
+	for host, child := range node.hosts {
+		existing, ok := n.hosts[host]
+		if !ok {
+			n.hosts[host] = child
+			continue
+		}
+		merged, err := existing.Merge(child)
+		if err != nil {
+			return nil, err
+		}
+		n.hosts[host] = merged
+	}
+wildcards:
+	for _, w := range node.wildcards {
+		for i, existing := range n.wildcards {
+			if existing.key != w.key || existing.suffix != w.suffix {
+				continue
+			}
+			merged, err := existing.router.Merge(w.router)
+			if err != nil {
+				return nil, err
+			}
+			n.wildcards[i].router = merged
+			continue wildcards
+		}
+		n.wildcards = append(n.wildcards, w)
+	}
+	return n, nil
+}